@@ -3,14 +3,58 @@ package werr
 
 import (
 	"bytes"
+	"context"
+	"encoding/json"
 	"errors"
 	"fmt"
-	"log"
+	"html"
+	"log/slog"
 	"math/rand"
 	"net/http"
 	"runtime"
+	"strings"
+	"sync"
 )
 
+// stackDepth is the maximum number of stack frames captured when wrapping an
+// error. It can be tuned with SetStackDepth.
+var stackDepth = 32
+
+// SetStackDepth sets the maximum number of stack frames captured by the
+// Error... constructors when they record the stack at the point of wrapping.
+// The default is 32. Pass 0 to disable stack capture entirely, which avoids
+// the cost of runtime.Callers on hot error paths.
+func SetStackDepth(n int) {
+	stackDepth = n
+}
+
+// captureStack returns up to stackDepth runtime.Frame values describing the
+// call stack, starting skip frames above its own caller.
+func captureStack(skip int) []runtime.Frame {
+
+	if stackDepth <= 0 {
+		return nil
+	}
+
+	pcs := make([]uintptr, stackDepth)
+	n := runtime.Callers(skip+2, pcs)
+	if n == 0 {
+		return nil
+	}
+
+	frames := runtime.CallersFrames(pcs[:n])
+	ret := make([]runtime.Frame, 0, n)
+	for {
+		frame, more := frames.Next()
+		ret = append(ret, frame)
+		if !more {
+			break
+		}
+	}
+
+	return ret
+}
+
 // ErrLoc wraps an error so it's Error() method will return the same text prefixed
 // with the file and line number it was called from.  A nil error value will return nil.
 func ErrLoc(err error) error {
@@ -41,6 +85,115 @@ type ErrorIDer interface{ ErrorID() string }
 // ErrorLocer interface is for errors that can return location (file:line) information.
 type ErrorLocer interface{ ErrorLoc() string }
 
+// ErrorStacker interface is for errors that can return the call stack captured
+// at the point they were wrapped.
+type ErrorStacker interface{ ErrorStack() []runtime.Frame }
+
+// ErrorContexter interface is for errors that can return structured key/value
+// context attached via WithContext.
+type ErrorContexter interface{ ErrorContext() map[string]any }
+
+// ErrorKind categorizes an error so that generic infrastructure (WriteError,
+// logging) can make reasonable decisions without knowing about concrete error
+// types. The zero value, KindInternal, is used for errors that don't specify
+// a kind.
+type ErrorKind int
+
+// ErrorKind values recognized by WriteError.
+const (
+	KindInternal ErrorKind = iota
+	KindBadInput
+	KindNotFound
+	KindUnauthorized
+	KindForbidden
+	KindConflict
+	KindTimeout
+	KindUnavailable
+)
+
+// String returns a human-readable name for k, used by the kind sentinel
+// errors' Error() method.
+func (k ErrorKind) String() string {
+	switch k {
+	case KindBadInput:
+		return "bad input"
+	case KindNotFound:
+		return "not found"
+	case KindUnauthorized:
+		return "unauthorized"
+	case KindForbidden:
+		return "forbidden"
+	case KindConflict:
+		return "conflict"
+	case KindTimeout:
+		return "timeout"
+	case KindUnavailable:
+		return "unavailable"
+	default:
+		return "internal"
+	}
+}
+
+// ErrorKinder interface is for errors that can return their ErrorKind.
+type ErrorKinder interface{ ErrorKind() ErrorKind }
+
+// kindDefaultCode maps an ErrorKind to the HTTP status code WriteError uses
+// when the error didn't set an explicit code.
+var kindDefaultCode = map[ErrorKind]int{
+	KindInternal:     500,
+	KindBadInput:     400,
+	KindNotFound:     404,
+	KindUnauthorized: 401,
+	KindForbidden:    403,
+	KindConflict:     409,
+	KindTimeout:      504,
+	KindUnavailable:  503,
+}
+
+// KindLogLevel maps an ErrorKind to the slog level WriteError logs it at.
+// Client errors default to warn so they don't trigger alerting the way
+// KindInternal does; callers can edit this table to change the defaults.
+var KindLogLevel = map[ErrorKind]slog.Level{
+	KindInternal:     slog.LevelError,
+	KindBadInput:     slog.LevelWarn,
+	KindNotFound:     slog.LevelWarn,
+	KindUnauthorized: slog.LevelWarn,
+	KindForbidden:    slog.LevelWarn,
+	KindConflict:     slog.LevelWarn,
+	KindTimeout:      slog.LevelError,
+	KindUnavailable:  slog.LevelError,
+}
+
+// kindSentinel is the concrete type behind the Err... sentinel values below.
+// errDetail's Is method matches any error of the same ErrorKind against it,
+// so errors.Is(err, werr.ErrNotFound) works regardless of the concrete error
+// wrapped underneath.
+type kindSentinel struct{ kind ErrorKind }
+
+func (k kindSentinel) Error() string { return k.kind.String() }
+
+// Sentinel errors for use with errors.Is, matching by ErrorKind rather than
+// by identity.
+var (
+	ErrBadInput     error = kindSentinel{KindBadInput}
+	ErrNotFound     error = kindSentinel{KindNotFound}
+	ErrUnauthorized error = kindSentinel{KindUnauthorized}
+	ErrForbidden    error = kindSentinel{KindForbidden}
+	ErrConflict     error = kindSentinel{KindConflict}
+	ErrTimeout      error = kindSentinel{KindTimeout}
+	ErrUnavailable  error = kindSentinel{KindUnavailable}
+)
+
+// AsKind walks err's Unwrap chain and returns the first ErrorKind found, and
+// whether one was found at all.
+func AsKind(err error) (ErrorKind, bool) {
+	var ek ErrorKinder
+	if errors.As(err, &ek) {
+		return ek.ErrorKind(), true
+	}
+	return KindInternal, false
+}
+
 // mkid returns a (usually) unique identifier
 func mkid() string {
 	return fmt.Sprintf("%X", rand.Int63())
@@ -48,11 +201,14 @@ func mkid() string {
 
 // errDetail is used internally by the Error... methods.
 type errDetail struct {
-	code int    // http status code
-	show string // message to return in HTTP response
-	loc  string // file:line info
-	err  error  // underlying error
-	id   string // unique id
+	code  int             // http status code
+	show  string          // message to return in HTTP response
+	loc   string          // file:line info
+	err   error           // underlying error
+	id    string          // unique id
+	stack []runtime.Frame // call stack captured at the point of wrapping
+	ctx   map[string]any  // structured context attached via WithContext
+	kind  ErrorKind       // error category, see ErrorKind
 }
 
 // Error implements the error interface.
@@ -91,11 +247,72 @@ func (e *errDetail) ErrorCode() int {
 	return ret
 }
 
+// ErrorStack returns the call stack captured at the point this error was
+// wrapped. When this error itself wraps another *errDetail further down the
+// chain (e.g. Errorf("outer: %w", innerWerrErr)), the deepest captured stack
+// is returned instead, since that's the one that points at the original
+// failure rather than just the most recent wrap.
+func (e *errDetail) ErrorStack() []runtime.Frame {
+	deepest := e.stack
+	for cur := error(e.err); cur != nil; cur = errors.Unwrap(cur) {
+		if ed, ok := cur.(*errDetail); ok && len(ed.stack) > 0 {
+			deepest = ed.stack
+		}
+	}
+	return deepest
+}
+
+// ErrorContext returns the structured key/value context attached via WithContext.
+func (e *errDetail) ErrorContext() map[string]any {
+	return e.ctx
+}
+
+// ErrorKind returns the category of this error. It defaults to KindInternal.
+func (e *errDetail) ErrorKind() ErrorKind {
+	return e.kind
+}
+
+// Is reports whether target is one of this package's kind sentinel errors
+// (ErrNotFound, ErrBadInput, ...) matching e's ErrorKind, so that
+// errors.Is(err, werr.ErrNotFound) works without needing to know the
+// concrete error type.
+func (e *errDetail) Is(target error) bool {
+	ks, ok := target.(kindSentinel)
+	if !ok {
+		return false
+	}
+	return e.kind == ks.kind
+}
+
 // Unwrap returns the underlying error
 func (e *errDetail) Unwrap() error {
 	return e.err
 }
 
+// Format implements fmt.Formatter so that "%+v" prints the error message
+// followed by its captured stack trace, mirroring the convention established
+// by github.com/pkg/errors. "%q" prints Error() quoted; every other verb,
+// including ones such as "%d" or "%x", prints Error() as-is.
+func (e *errDetail) Format(f fmt.State, verb rune) {
+	switch verb {
+	case 'v':
+		if f.Flag('+') {
+			fmt.Fprint(f, e.Error())
+			for _, fr := range e.stack {
+				fmt.Fprintf(f, "\n%s\n\t%s:%d", fr.Function, fr.File, fr.Line)
+			}
+			return
+		}
+		fallthrough
+	case 's':
+		fmt.Fprint(f, e.Error())
+	case 'q':
+		fmt.Fprintf(f, "%q", e.Error())
+	default:
+		fmt.Fprint(f, e.Error())
+	}
+}
+
 // Error returns an error wrapped with the calling location and a unique ID.
 // If error has already been wrapped by a call from this package cause will be returned.
 // Passing a nil error will return nil
@@ -116,9 +333,10 @@ func Error(cause error) error {
 	_, file, line, _ := runtime.Caller(1)
 
 	ret := errDetail{
-		loc: fmt.Sprintf("%s:%v", file, line),
-		err: fmt.Errorf("%w", cause),
-		id:  mkid(),
+		loc:   fmt.Sprintf("%s:%v", file, line),
+		err:   fmt.Errorf("%w", cause),
+		id:    mkid(),
+		stack: captureStack(1),
 	}
 
 	return &ret
@@ -131,9 +349,10 @@ func Errorf(fmtstr string, args ...interface{}) error {
 	_, file, line, _ := runtime.Caller(1)
 
 	ret := errDetail{
-		loc: fmt.Sprintf("%s:%v", file, line),
-		err: fmt.Errorf(fmtstr, args...),
-		id:  mkid(),
+		loc:   fmt.Sprintf("%s:%v", file, line),
+		err:   fmt.Errorf(fmtstr, args...),
+		id:    mkid(),
+		stack: captureStack(1),
 	}
 
 	return &ret
@@ -145,10 +364,11 @@ func ErrorCodef(code int, fmtstr string, args ...interface{}) error {
 	_, file, line, _ := runtime.Caller(1)
 
 	ret := errDetail{
-		code: code,
-		loc:  fmt.Sprintf("%s:%v", file, line),
-		err:  fmt.Errorf(fmtstr, args...),
-		id:   mkid(),
+		code:  code,
+		loc:   fmt.Sprintf("%s:%v", file, line),
+		err:   fmt.Errorf(fmtstr, args...),
+		id:    mkid(),
+		stack: captureStack(1),
 	}
 
 	return &ret
@@ -166,10 +386,11 @@ func ErrorShowf(cause error, fmtstr string, args ...interface{}) error {
 	_, file, line, _ := runtime.Caller(1)
 
 	ret := errDetail{
-		loc:  fmt.Sprintf("%s:%v", file, line),
-		show: show,
-		err:  cause,
-		id:   mkid(),
+		loc:   fmt.Sprintf("%s:%v", file, line),
+		show:  show,
+		err:   cause,
+		id:    mkid(),
+		stack: captureStack(1),
 	}
 
 	return &ret
@@ -188,53 +409,453 @@ func ErrorCodeShowf(code int, cause error, fmtstr string, args ...interface{}) e
 	_, file, line, _ := runtime.Caller(1)
 
 	ret := errDetail{
-		code: code,
-		loc:  fmt.Sprintf("%s:%v", file, line),
-		show: show,
-		err:  cause,
-		id:   mkid(),
+		code:  code,
+		loc:   fmt.Sprintf("%s:%v", file, line),
+		show:  show,
+		err:   cause,
+		id:    mkid(),
+		stack: captureStack(1),
 	}
 
 	return &ret
 
 }
 
-// WriteError will write an error as an HTTP response and take into account the other wrapping from this package.
-func WriteError(w http.ResponseWriter, err error) error {
+// ErrorKindf is like Errorf but also categorizes the error with kind, which
+// WriteError uses to pick a default HTTP status code and log level when no
+// explicit code was set.
+func ErrorKindf(kind ErrorKind, fmtstr string, args ...interface{}) error {
+
+	_, file, line, _ := runtime.Caller(1)
+
+	ret := errDetail{
+		kind:  kind,
+		loc:   fmt.Sprintf("%s:%v", file, line),
+		err:   fmt.Errorf(fmtstr, args...),
+		id:    mkid(),
+		stack: captureStack(1),
+	}
+
+	return &ret
+}
+
+// WithContext attaches structured key/value context to err, which can later be
+// retrieved with ToMap or ToSlog, and is included in the structured log record
+// emitted by WriteError. kv is interpreted as alternating key/value pairs,
+// where keys must be strings; malformed pairs are ignored. If err was already
+// wrapped by this package its context is copied into a new errDetail along
+// with kv, otherwise err is wrapped the same way Error does; either way err
+// itself is left unmodified, so the same base error can be annotated
+// independently from multiple places. A nil err returns nil.
+func WithContext(err error, kv ...any) error {
 
 	if err == nil {
 		return nil
 	}
 
-	log.Printf("Error: %s", err.Error())
+	orig, ok := err.(*errDetail)
+	if !ok {
+		_, file, line, _ := runtime.Caller(1)
+		orig = &errDetail{
+			loc:   fmt.Sprintf("%s:%v", file, line),
+			err:   fmt.Errorf("%w", err),
+			id:    mkid(),
+			stack: captureStack(1),
+		}
+	}
+
+	// Copy rather than mutate orig in place: orig may be a shared base error
+	// (e.g. a sentinel annotated per-call), and mutating it would let one
+	// WithContext call's kv bleed into every other holder of the same
+	// pointer, plus race on the map under concurrent use.
+	ed := *orig
+	ed.ctx = make(map[string]any, len(orig.ctx)+len(kv)/2)
+	for k, v := range orig.ctx {
+		ed.ctx[k] = v
+	}
+	for i := 0; i+1 < len(kv); i += 2 {
+		key, ok := kv[i].(string)
+		if !ok {
+			continue
+		}
+		ed.ctx[key] = kv[i+1]
+	}
+
+	return &ed
+}
 
-	var ret error
+// ToMap walks the Unwrap chain of err and merges the context of every
+// ErrorContexter found, with context from errors closer to err (i.e. added
+// later via WithContext) taking precedence over context from errors further
+// down the chain.
+func ToMap(err error) map[string]any {
+
+	var layers []map[string]any
+	for e := err; e != nil; e = errors.Unwrap(e) {
+		if ec, ok := e.(ErrorContexter); ok {
+			if m := ec.ErrorContext(); len(m) > 0 {
+				layers = append(layers, m)
+			}
+		}
+	}
 
-	w.Header().Set("Content-Type", "text/plain")
+	ret := make(map[string]any)
+	for i := len(layers) - 1; i >= 0; i-- {
+		for k, v := range layers[i] {
+			ret[k] = v
+		}
+	}
+
+	return ret
+}
+
+// ToSlog returns the merged context of err (see ToMap) as a slice of slog.Attr,
+// suitable for passing to a *slog.Logger.
+func ToSlog(err error) []slog.Attr {
+
+	m := ToMap(err)
+	ret := make([]slog.Attr, 0, len(m))
+	for k, v := range m {
+		ret = append(ret, slog.Any(k, v))
+	}
+
+	return ret
+}
+
+// logger is the *slog.Logger used by WriteError to emit structured error
+// records. Override it with SetLogger.
+var logger = slog.Default()
+
+// SetLogger overrides the *slog.Logger used by WriteError. Passing nil
+// restores slog.Default().
+func SetLogger(l *slog.Logger) {
+	if l == nil {
+		l = slog.Default()
+	}
+	logger = l
+}
+
+// resolveCode returns the HTTP status code for err: the explicit code of the
+// first *errDetail in its chain if set, else the default for the first
+// ErrorKind in the chain, else the code of the first ErrorCoder, else 500.
+func resolveCode(err error) int {
+
+	// An explicit code on our own errDetail always wins. This is checked via
+	// the unexported field, rather than the public ErrorCoder.ErrorCode(),
+	// because that method has its own long-standing 0->500 fallback and so
+	// can't tell us whether a code was actually set.
+	var ed *errDetail
+	if errors.As(err, &ed) && ed.code != 0 {
+		return ed.code
+	}
+
+	if kind, ok := AsKind(err); ok {
+		if code, ok := kindDefaultCode[kind]; ok {
+			return code
+		}
+	}
 
 	var ec ErrorCoder
 	if errors.As(err, &ec) {
-		w.WriteHeader(ec.ErrorCode())
-	} else {
-		w.WriteHeader(500)
+		return ec.ErrorCode()
 	}
 
-	var showText string
-	var es ErrorShower
+	return 500
+}
+
+// logError emits a single structured log record for err, containing its ID,
+// code, location, stack, and merged context, at a level chosen from
+// KindLogLevel based on its ErrorKind.
+func logError(err error) {
+
+	code := resolveCode(err)
+	attrs := []slog.Attr{slog.Int("code", code)}
+
+	var ei ErrorIDer
+	if errors.As(err, &ei) {
+		attrs = append(attrs, slog.String("id", ei.ErrorID()))
+	}
+
+	var el ErrorLocer
+	if errors.As(err, &el) {
+		attrs = append(attrs, slog.String("loc", el.ErrorLoc()))
+	}
+
+	var es ErrorStacker
 	if errors.As(err, &es) {
-		showText = es.ErrorShow()
+		attrs = append(attrs, slog.Any("stack", es.ErrorStack()))
+	}
+
+	if ctx := ToMap(err); len(ctx) > 0 {
+		attrs = append(attrs, slog.Any("context", ctx))
 	}
-	if showText == "" {
-		showText = "internal error"
+
+	kind, _ := AsKind(err)
+	level, ok := KindLogLevel[kind]
+	if !ok {
+		level = slog.LevelError
 	}
 
-	_, ret = fmt.Fprint(w, showText)
+	logger.LogAttrs(context.Background(), level, err.Error(), attrs...)
+}
+
+// Debug controls whether the built-in text/html renderer includes the
+// location, stack and context of an error in its output, for use in
+// development. It should not be enabled in production, as it can leak
+// internal details to clients.
+var Debug bool
+
+// ErrorInfo carries the information WriteError and WriteErrorRequest extract
+// from a wrapped error, for use by a Renderer.
+type ErrorInfo struct {
+	ID      string
+	Code    int
+	Show    string
+	Loc     string
+	Stack   []runtime.Frame
+	Context map[string]any
+	Err     error
+}
+
+// buildErrorInfo extracts an ErrorInfo from err using the ErrorXxxer
+// interfaces implemented by this package's wrapped errors.
+func buildErrorInfo(err error) ErrorInfo {
+
+	info := ErrorInfo{Code: resolveCode(err), Err: err}
+
+	var es ErrorShower
+	if errors.As(err, &es) {
+		info.Show = es.ErrorShow()
+	}
+	if info.Show == "" {
+		info.Show = "internal error"
+	}
 
 	var ei ErrorIDer
 	if errors.As(err, &ei) {
-		_, ret = fmt.Fprintf(w, " [ID:%s]", ei.ErrorID())
+		info.ID = ei.ErrorID()
+	}
+
+	var el ErrorLocer
+	if errors.As(err, &el) {
+		info.Loc = el.ErrorLoc()
+	}
+
+	var est ErrorStacker
+	if errors.As(err, &est) {
+		info.Stack = est.ErrorStack()
+	}
+
+	info.Context = ToMap(err)
+
+	return info
+}
+
+// Renderer writes an ErrorInfo to an HTTP response in some media type.
+// RegisterRenderer associates a Renderer with the media type it handles.
+type Renderer interface {
+	Render(w http.ResponseWriter, r *http.Request, info ErrorInfo) error
+}
+
+var (
+	renderersMu sync.RWMutex
+	renderers   = map[string]Renderer{}
+)
+
+// RegisterRenderer associates a Renderer with mediaType (e.g. "application/json"),
+// for use by WriteErrorRequest when a request's Accept header names it.
+func RegisterRenderer(mediaType string, r Renderer) {
+	renderersMu.Lock()
+	defer renderersMu.Unlock()
+	renderers[mediaType] = r
+}
+
+func init() {
+	RegisterRenderer("text/plain", textRenderer{})
+	RegisterRenderer("application/json", jsonRenderer{})
+	RegisterRenderer("text/html", htmlRenderer{})
+}
+
+// selectRenderer picks a Renderer for r based on its Accept header, falling
+// back to the text/plain renderer if nothing registered matches.
+func selectRenderer(r *http.Request) Renderer {
+
+	renderersMu.RLock()
+	defer renderersMu.RUnlock()
+
+	for _, part := range strings.Split(r.Header.Get("Accept"), ",") {
+		mt := strings.TrimSpace(part)
+		if i := strings.Index(mt, ";"); i >= 0 {
+			mt = strings.TrimSpace(mt[:i])
+		}
+		if rend, ok := renderers[mt]; ok {
+			return rend
+		}
+	}
+
+	return renderers["text/plain"]
+}
+
+// textRenderer is the original plain-text rendering WriteError has always done.
+type textRenderer struct{}
+
+func (textRenderer) Render(w http.ResponseWriter, r *http.Request, info ErrorInfo) error {
+
+	w.Header().Set("Content-Type", "text/plain")
+	w.WriteHeader(info.Code)
+
+	_, err := fmt.Fprint(w, info.Show)
+	if info.ID != "" {
+		_, err = fmt.Fprintf(w, " [ID:%s]", info.ID)
+	}
+
+	return err
+}
+
+// jsonRenderer renders an RFC 7807 Problem Details JSON document.
+type jsonRenderer struct{}
+
+func (jsonRenderer) Render(w http.ResponseWriter, r *http.Request, info ErrorInfo) error {
+
+	doc := struct {
+		Type     string `json:"type,omitempty"`
+		Title    string `json:"title,omitempty"`
+		Status   int    `json:"status,omitempty"`
+		Detail   string `json:"detail,omitempty"`
+		Instance string `json:"instance,omitempty"`
+		ID       string `json:"id,omitempty"`
+	}{
+		Title:  http.StatusText(info.Code),
+		Status: info.Code,
+		Detail: info.Show,
+		ID:     info.ID,
+	}
+	if r != nil {
+		doc.Instance = r.URL.Path
+	}
+
+	w.Header().Set("Content-Type", "application/problem+json")
+	w.WriteHeader(info.Code)
+
+	return json.NewEncoder(w).Encode(doc)
+}
+
+// htmlRenderer renders a simple debug page. When Debug is false it shows only
+// the show message and ID, the same as a client would normally see.
+type htmlRenderer struct{}
+
+func (htmlRenderer) Render(w http.ResponseWriter, r *http.Request, info ErrorInfo) error {
+
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.WriteHeader(info.Code)
+
+	fmt.Fprint(w, "<html><head><title>Error</title></head><body>\n")
+	fmt.Fprintf(w, "<h1>%s</h1>\n", html.EscapeString(info.Show))
+	if info.ID != "" {
+		fmt.Fprintf(w, "<p>ID: %s</p>\n", html.EscapeString(info.ID))
+	}
+
+	if Debug {
+		if info.Loc != "" {
+			fmt.Fprintf(w, "<p>Location: %s</p>\n", html.EscapeString(info.Loc))
+		}
+		if info.Err != nil {
+			fmt.Fprintf(w, "<pre>%s</pre>\n", html.EscapeString(info.Err.Error()))
+		}
+		if len(info.Context) > 0 {
+			fmt.Fprint(w, "<h2>Context</h2>\n<ul>\n")
+			for k, v := range info.Context {
+				fmt.Fprintf(w, "<li>%s: %s</li>\n", html.EscapeString(k), html.EscapeString(fmt.Sprint(v)))
+			}
+			fmt.Fprint(w, "</ul>\n")
+		}
+		if len(info.Stack) > 0 {
+			fmt.Fprint(w, "<h2>Stack</h2>\n<pre>\n")
+			for _, fr := range info.Stack {
+				fmt.Fprintf(w, "%s\n\t%s:%d\n", html.EscapeString(fr.Function), html.EscapeString(fr.File), fr.Line)
+			}
+			fmt.Fprint(w, "</pre>\n")
+		}
+	}
+
+	_, err := fmt.Fprint(w, "</body></html>\n")
+	return err
+}
+
+// WriteError will write an error as a plain-text HTTP response and take into
+// account the other wrapping from this package. It always uses the built-in
+// plain-text renderer, even if another Renderer was registered for text/plain.
+func WriteError(w http.ResponseWriter, err error) error {
+
+	if err == nil {
+		return nil
+	}
+
+	logError(err)
+
+	return textRenderer{}.Render(w, nil, buildErrorInfo(err))
+}
+
+// WriteErrorRequest is like WriteError but selects a Renderer based on r's
+// Accept header (see RegisterRenderer), so a single handler can serve both
+// plain-text and JSON or HTML clients.
+func WriteErrorRequest(w http.ResponseWriter, r *http.Request, err error) error {
+
+	if err == nil {
+		return nil
+	}
+
+	logError(err)
+
+	return selectRenderer(r).Render(w, r, buildErrorInfo(err))
+}
+
+// recoverError converts a value recovered from a panic into a KindInternal
+// error carrying a captured stack and a unique ID, so it can be reported the
+// same way as any other error from this package.
+func recoverError(rec interface{}) error {
+
+	cause, ok := rec.(error)
+	if !ok {
+		cause = fmt.Errorf("%v", rec)
+	}
+
+	ret := &errDetail{
+		kind:  KindInternal,
+		err:   cause,
+		id:    mkid(),
+		stack: captureStack(1),
+	}
+	if len(ret.stack) > 0 {
+		ret.loc = fmt.Sprintf("%s:%d", ret.stack[0].File, ret.stack[0].Line)
 	}
 
 	return ret
+}
+
+// HandlerFunc is a fallible HTTP handler: like http.HandlerFunc, but it may
+// return an error instead of writing a response itself.
+type HandlerFunc func(w http.ResponseWriter, r *http.Request) error
+
+// ServeHTTP implements http.Handler. It recovers any panic from f, including
+// a nil-pointer panic, converting it into a KindInternal error, and reports
+// any returned or recovered error with WriteErrorRequest.
+func (f HandlerFunc) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+
+	defer func() {
+		if rec := recover(); rec != nil {
+			WriteErrorRequest(w, r, recoverError(rec))
+		}
+	}()
+
+	if err := f(w, r); err != nil {
+		WriteErrorRequest(w, r, err)
+	}
+}
 
+// Handler adapts a fallible handler function to http.Handler using
+// HandlerFunc, so a crashing or erroring handler still produces a
+// correlatable response and log record instead of tearing down the server.
+func Handler(f func(w http.ResponseWriter, r *http.Request) error) http.Handler {
+	return HandlerFunc(f)
 }
@@ -1,61 +1,269 @@
 package werr
 
-import "net/http"
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
 
-func ExampleFull() {
+func TestErrorStack(t *testing.T) {
+
+	err := Errorf("boom")
+
+	var es ErrorStacker
+	if !errors.As(err, &es) {
+		t.Fatal("expected err to implement ErrorStacker")
+	}
+
+	stack := es.ErrorStack()
+	if len(stack) == 0 {
+		t.Fatal("expected a non-empty stack")
+	}
+
+	// wrapping an already-wrapped error should return it as-is, so the
+	// innermost stack (captured where Errorf was originally called) is
+	// still what's surfaced.
+	wrapped := Error(err)
+	var es2 ErrorStacker
+	if !errors.As(wrapped, &es2) {
+		t.Fatal("expected wrapped err to implement ErrorStacker")
+	}
+	if len(es2.ErrorStack()) != len(stack) {
+		t.Fatal("expected wrapping to preserve the innermost stack")
+	}
+}
+
+func TestErrorStackNestedWrap(t *testing.T) {
+
+	inner := Errorf("inner failure")
+	var innerStacker ErrorStacker
+	if !errors.As(inner, &innerStacker) {
+		t.Fatal("expected inner to implement ErrorStacker")
+	}
+	innerStack := innerStacker.ErrorStack()
+
+	// outer wraps inner via %w rather than being handed back as-is, so it's
+	// a genuinely new errDetail with its own (more recent) call site.
+	outer := Errorf("outer: %w", inner)
+	var outerStacker ErrorStacker
+	if !errors.As(outer, &outerStacker) {
+		t.Fatal("expected outer to implement ErrorStacker")
+	}
+	outerStack := outerStacker.ErrorStack()
+
+	if len(outerStack) == 0 || len(innerStack) == 0 {
+		t.Fatal("expected non-empty stacks")
+	}
+	if outerStack[0].Line != innerStack[0].Line || outerStack[0].File != innerStack[0].File {
+		t.Fatalf("expected ErrorStack to surface the innermost call site, got %s:%d, want %s:%d",
+			outerStack[0].File, outerStack[0].Line, innerStack[0].File, innerStack[0].Line)
+	}
+}
+
+func TestErrorFormatFallsBackForOtherVerbs(t *testing.T) {
+
+	err := Errorf("boom")
+
+	got := fmt.Sprintf("%d", err)
+	if got != err.Error() {
+		t.Fatalf("expected unrecognized verb to fall back to Error(), got %q, want %q", got, err.Error())
+	}
+}
+
+func TestWithContext(t *testing.T) {
+
+	err := Errorf("boom")
+	err = WithContext(err, "userID", "u1")
+	err = WithContext(err, "route", "/widgets", "userID", "u2")
+
+	m := ToMap(err)
+	if m["userID"] != "u2" {
+		t.Fatalf("expected later WithContext call to win, got %v", m["userID"])
+	}
+	if m["route"] != "/widgets" {
+		t.Fatalf("expected route to be present, got %v", m["route"])
+	}
+}
+
+func TestWithContextDoesNotMutateBase(t *testing.T) {
+
+	base := Errorf("boom")
+	a := WithContext(base, "user", "bob")
+	b := WithContext(base, "user", "alice")
+
+	if a == b {
+		t.Fatal("expected WithContext to return distinct errors for the same base")
+	}
+	if got := ToMap(a)["user"]; got != "bob" {
+		t.Fatalf("expected a's context to stay bob, got %v", got)
+	}
+	if got := ToMap(b)["user"]; got != "alice" {
+		t.Fatalf("expected b's context to be alice, got %v", got)
+	}
+	if len(ToMap(base)) != 0 {
+		t.Fatalf("expected base to be unmodified, got %v", ToMap(base))
+	}
+}
+
+func TestWriteErrorRequestJSON(t *testing.T) {
+
+	err := ErrorCodeShowf(404, errors.New("cause"), "not found")
+
+	req := httptest.NewRequest(http.MethodGet, "/widgets/1", nil)
+	req.Header.Set("Accept", "application/json")
+	rec := httptest.NewRecorder()
+
+	if err := WriteErrorRequest(rec, req, err); err != nil {
+		t.Fatal(err)
+	}
+
+	if ct := rec.Header().Get("Content-Type"); ct != "application/problem+json" {
+		t.Fatalf("unexpected content type: %s", ct)
+	}
+	if rec.Code != 404 {
+		t.Fatalf("expected 404, got %d", rec.Code)
+	}
+	if !strings.Contains(rec.Body.String(), `"detail":"not found"`) {
+		t.Fatalf("unexpected body: %s", rec.Body.String())
+	}
+}
+
+func TestHTMLRendererEscapesContextValues(t *testing.T) {
+
+	Debug = true
+	defer func() { Debug = false }()
+
+	err := Errorf("boom")
+	err = WithContext(err, "evil", "<script>alert(1)</script>")
+
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+	req.Header.Set("Accept", "text/html")
+	rec := httptest.NewRecorder()
+
+	if err := WriteErrorRequest(rec, req, err); err != nil {
+		t.Fatal(err)
+	}
+
+	if strings.Contains(rec.Body.String(), "<script>alert(1)</script>") {
+		t.Fatalf("expected context value to be HTML-escaped, got: %s", rec.Body.String())
+	}
+	if !strings.Contains(rec.Body.String(), "&lt;script&gt;") {
+		t.Fatalf("expected escaped context value in body, got: %s", rec.Body.String())
+	}
+}
+
+func TestErrorKind(t *testing.T) {
+
+	err := ErrorKindf(KindNotFound, "widget %d missing", 42)
+
+	if !errors.Is(err, ErrNotFound) {
+		t.Fatal("expected errors.Is to match ErrNotFound by kind")
+	}
+	if errors.Is(err, ErrBadInput) {
+		t.Fatal("expected errors.Is to not match a different kind")
+	}
+
+	if resolveCode(err) != 404 {
+		t.Fatalf("expected default code 404 for KindNotFound, got %d", resolveCode(err))
+	}
+}
+
+func TestErrorCoderDefaultsTo500(t *testing.T) {
+
+	// ErrorCode() is a public, documented way to get a status code directly,
+	// predating resolveCode's kind-aware defaulting; it must keep returning
+	// a usable code rather than 0 when none was explicitly set.
+	err := Errorf("boom")
+
+	var ec ErrorCoder
+	if !errors.As(err, &ec) {
+		t.Fatal("expected err to implement ErrorCoder")
+	}
+	if code := ec.ErrorCode(); code != 500 {
+		t.Fatalf("expected ErrorCode() to default to 500, got %d", code)
+	}
+}
+
+func TestHandlerRecoversPanic(t *testing.T) {
+
+	h := Handler(func(w http.ResponseWriter, r *http.Request) error {
+		var p *int
+		_ = *p // nil-pointer panic
+		return nil
+	})
+
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+	rec := httptest.NewRecorder()
+
+	h.ServeHTTP(rec, req)
+
+	if rec.Code != 500 {
+		t.Fatalf("expected 500, got %d", rec.Code)
+	}
+	if !strings.Contains(rec.Body.String(), "internal error") {
+		t.Fatalf("unexpected body: %s", rec.Body.String())
+	}
+}
+
+func Example() {
 
 	// placeholder
 	something := func() error { return nil }
 
-	// handlers implements http.Handler and thus return no error
-	_ = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-
-		// wrap your handler in a WriteError which does sensible things with errors
-		WriteError(w, func() error {
-
-			err := something()
-			if err != nil {
-				// you can return errors as-is and WriteError will
-				// send a generic 500 response and log err
-				return err
-			}
-
-			err = something()
-			if err != nil {
-				// wrapping with Error() will record the file and line number
-				return Error(err)
-			}
-
-			err = something()
-			if err != nil {
-				// Errorf is like fmt.Errorf but automtically includes an ID and file:line number in the log
-				return Errorf("something failed: %w", err) // error only shows in log, not response
-			}
-
-			err = something()
-			if err != nil {
-				// ErrorCodef is like Errorf but allows you to set an HTTP status code
-				return ErrorCodef(400, "bad input: %w", err) // error only shows in log, not response
-			}
-
-			err = something()
-			if err != nil {
-				// ErrorShowf can be used to provide an error message that shows in the response
-				return ErrorShowf(err, "something internal went awry") // message is sent in response and log, err shows in log
-			}
-
-			err = something()
-			if err != nil {
-				// ErrorCodeShowf is like ErrorShowf but with an http response code
-				return ErrorCodeShowf(504, err, "something internal went awry")
-			}
-
-			// TODO: write successful response
-
-			// WriteError does nothing if passed nil
-			return nil
-		}())
+	// Handler wraps a fallible handler func, recovering panics and calling
+	// WriteErrorRequest on any returned error, so there's no boilerplate
+	// left in the handler itself.
+	_ = Handler(func(w http.ResponseWriter, r *http.Request) error {
+
+		err := something()
+		if err != nil {
+			// you can return errors as-is and WriteErrorRequest will
+			// send a generic 500 response and log err
+			return err
+		}
+
+		err = something()
+		if err != nil {
+			// wrapping with Error() will record the file and line number
+			return Error(err)
+		}
+
+		err = something()
+		if err != nil {
+			// Errorf is like fmt.Errorf but automtically includes an ID and file:line number in the log
+			return Errorf("something failed: %w", err) // error only shows in log, not response
+		}
+
+		err = something()
+		if err != nil {
+			// ErrorCodef is like Errorf but allows you to set an HTTP status code
+			return ErrorCodef(400, "bad input: %w", err) // error only shows in log, not response
+		}
+
+		err = something()
+		if err != nil {
+			// ErrorShowf can be used to provide an error message that shows in the response
+			return ErrorShowf(err, "something internal went awry") // message is sent in response and log, err shows in log
+		}
+
+		err = something()
+		if err != nil {
+			// ErrorCodeShowf is like ErrorShowf but with an http response code
+			return ErrorCodeShowf(504, err, "something internal went awry")
+		}
+
+		err = something()
+		if err != nil {
+			// ErrorKindf categorizes the error, driving the default status code and log level
+			return ErrorKindf(KindNotFound, "widget not found: %w", err)
+		}
+
+		// TODO: write successful response
 
+		return nil
 	})
 
 }